@@ -0,0 +1,104 @@
+package serversets
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+
+	"github.com/go-zookeeper/zk"
+)
+
+// AuthProvider supplies the ACL applied to znodes created by this
+// package and, optionally, authenticates the ZooKeeper connection
+// before it's used for any create/exists call. It lets a ServerSet be
+// used against a secured cluster (Kerberos, digest auth, chroot'd
+// tenants) instead of the always-world-writable default.
+type AuthProvider interface {
+	// ACL returns the ACL applied to member znodes.
+	ACL() []zk.ACL
+
+	// AddAuth authenticates conn, if needed, before it's used.
+	AddAuth(conn *zk.Conn) error
+}
+
+// DirectoryACLProvider is an optional extension to AuthProvider for
+// providers that want the parent directory znodes (created by
+// createFullPath) to carry a different ACL than the member znodes
+// themselves -- useful when multiple tenants share a common
+// BaseDirectory like /aurora and the directories need to stay
+// world-readable even though membership is restricted.
+type DirectoryACLProvider interface {
+	AuthProvider
+
+	// DirectoryACL returns the ACL applied to parent directory znodes.
+	DirectoryACL() []zk.ACL
+}
+
+// worldACLAuth is the default AuthProvider. It preserves the historical
+// zk.WorldACL(zk.PermAll) behavior and performs no authentication.
+type worldACLAuth struct{}
+
+func (worldACLAuth) ACL() []zk.ACL { return zk.WorldACL(zk.PermAll) }
+
+func (worldACLAuth) AddAuth(conn *zk.Conn) error { return nil }
+
+// digestAuth authenticates with ZooKeeper's built-in "digest" auth
+// scheme and restricts member znodes to that identity, while keeping
+// parent directories world-readable.
+type digestAuth struct {
+	user     string
+	password string
+}
+
+// DigestAuth returns an AuthProvider that authenticates the ZooKeeper
+// connection using the "digest" scheme with user and password, and
+// gives that identity exclusive write access to member znodes while
+// leaving them (and the parent directories) world-readable.
+func DigestAuth(user, password string) AuthProvider {
+	return &digestAuth{user: user, password: password}
+}
+
+func (d *digestAuth) ACL() []zk.ACL {
+	return append(digestACL(zk.PermAll, d.user, d.password), zk.WorldACL(zk.PermRead)...)
+}
+
+func (d *digestAuth) DirectoryACL() []zk.ACL {
+	return append(digestACL(zk.PermAll, d.user, d.password), zk.WorldACL(zk.PermRead|zk.PermCreate)...)
+}
+
+func (d *digestAuth) AddAuth(conn *zk.Conn) error {
+	return conn.AddAuth("digest", []byte(d.user+":"+d.password))
+}
+
+// digestACL builds the single ACL entry ZooKeeper expects for the
+// "digest" scheme: scheme "digest" and an ID of "user:base64(sha1(user:password))".
+func digestACL(perms int32, user, password string) []zk.ACL {
+	sum := sha1.Sum([]byte(user + ":" + password))
+	return []zk.ACL{{
+		Perms:  perms,
+		Scheme: "digest",
+		ID:     user + ":" + base64.StdEncoding.EncodeToString(sum[:]),
+	}}
+}
+
+// rawAuth authenticates with an arbitrary ZooKeeper auth scheme/
+// credential pair while leaving the default world ACL on created
+// znodes untouched.
+type rawAuth struct {
+	scheme string
+	cred   string
+}
+
+// RawAuth returns an AuthProvider that authenticates the ZooKeeper
+// connection by calling conn.AddAuth(scheme, cred), for schemes (e.g.
+// "sasl", "ip", or a custom scheme registered on the server) that don't
+// need a matching ACL change. Wrap or replace it if the scheme also
+// requires a non-default ACL.
+func RawAuth(scheme, cred string) AuthProvider {
+	return &rawAuth{scheme: scheme, cred: cred}
+}
+
+func (r *rawAuth) ACL() []zk.ACL { return zk.WorldACL(zk.PermAll) }
+
+func (r *rawAuth) AddAuth(conn *zk.Conn) error {
+	return conn.AddAuth(r.scheme, []byte(r.cred))
+}
@@ -0,0 +1,290 @@
+package serversets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/go-zookeeper/zk"
+)
+
+// ElectionPrefix is the prefix used for the ephemeral sequential
+// candidate nodes created by Election.Campaign.
+var ElectionPrefix = "candidate_"
+
+// Election implements the standard ZooKeeper leader-election /
+// distributed-lock recipe on top of a ServerSet's namespace: each
+// competitor creates an ephemeral-sequential child and the one holding
+// the lowest sequence number is the leader; everyone else watches the
+// sibling immediately before them and re-checks when it disappears.
+//
+// An Election is single-use: once a campaign's session expires, that
+// Election refuses further campaigns and a new one must be created.
+type Election struct {
+	ss     *ServerSet
+	dir    string
+	entity *Entity
+
+	mu       sync.Mutex
+	conn     *zk.Conn
+	events   <-chan zk.Event
+	nodePath string
+	expired  bool
+	err      error
+
+	// resignOnce and resigned are per-campaign: Campaign replaces both
+	// (under mu) each time it's called, so a Resign left over from an
+	// earlier campaign can never no-op a later one.
+	resignOnce *sync.Once
+	resigned   chan struct{}
+}
+
+// NewElection creates an Election that coordinates leadership among
+// competitors using ss's ZooKeeper servers and ACL provider, under the
+// dedicated namespace "<ss directory>/election". host and port identify
+// this process to observers via Leader.
+func NewElection(ss *ServerSet, host string, port int) *Election {
+	return &Election{
+		ss:     ss,
+		dir:    ss.directoryPath() + "/election",
+		entity: newEntity(host, port),
+	}
+}
+
+// Campaign enters the election, blocking until this process becomes
+// leader or ctx is canceled. On success it returns a channel that is
+// closed when leadership is lost, whether voluntarily via Resign or
+// because the candidate's ephemeral node disappeared or its session
+// expired while the campaign was still running; call Err afterward to
+// tell the two apart. A lost-by-expiration Election must be discarded
+// and replaced with a new one; any other loss can be re-campaigned.
+func (e *Election) Campaign(ctx context.Context) (<-chan struct{}, error) {
+	e.mu.Lock()
+	if e.expired {
+		e.mu.Unlock()
+		return nil, fmt.Errorf("serversets: election session has expired, create a new Election to campaign again")
+	}
+	e.mu.Unlock()
+
+	conn, events, err := e.ss.connectToZookeeper()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := e.ss.createPath(conn, e.dir); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	data, err := json.Marshal(e.entity)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	nodePath, err := conn.Create(path.Join(e.dir, ElectionPrefix), data, zk.FlagEphemeral|zk.FlagSequence, e.ss.memberACL())
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	e.mu.Lock()
+	e.conn = conn
+	e.events = events
+	e.nodePath = nodePath
+	e.err = nil
+	e.resigned = make(chan struct{})
+	e.resignOnce = &sync.Once{}
+	e.mu.Unlock()
+
+	if err := e.waitToLead(ctx); err != nil {
+		conn.Delete(nodePath, -1)
+		conn.Close()
+		return nil, err
+	}
+
+	lost := make(chan struct{})
+	go e.watchLeadership(lost)
+
+	return lost, nil
+}
+
+// waitToLead blocks until e's candidate node holds the lowest sequence
+// number among its siblings, or ctx is canceled.
+func (e *Election) waitToLead(ctx context.Context) error {
+	self := path.Base(e.nodePath)
+
+	for {
+		children, _, err := e.conn.Children(e.dir)
+		if err != nil {
+			return err
+		}
+		sort.Strings(children)
+
+		pos := -1
+		for i, child := range children {
+			if child == self {
+				pos = i
+				break
+			}
+		}
+		if pos == -1 {
+			return fmt.Errorf("serversets: candidate node %s disappeared before the campaign completed", self)
+		}
+		if pos == 0 {
+			return nil
+		}
+
+		predecessor := path.Join(e.dir, children[pos-1])
+		exists, _, watch, err := e.conn.ExistsW(predecessor)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		select {
+		case <-watch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// watchLeadership runs for as long as e holds leadership, closing lost
+// as soon as that's no longer true. On every loss path except a
+// voluntary Resign (which closes the connection itself), it closes
+// e.conn so the next Campaign's fresh connection doesn't leak the old
+// one's background goroutines.
+func (e *Election) watchLeadership(lost chan struct{}) {
+	defer close(lost)
+
+	for {
+		exists, _, watch, err := e.conn.ExistsW(e.nodePath)
+		if err != nil {
+			e.setErr(err)
+			e.conn.Close()
+			return
+		}
+		if !exists {
+			e.setErr(fmt.Errorf("serversets: candidate node %s was deleted out from under the campaign", e.nodePath))
+			e.conn.Close()
+			return
+		}
+
+		select {
+		case <-e.resigned:
+			return
+
+		case evt := <-watch:
+			if evt.Type == zk.EventNodeDeleted {
+				e.setErr(fmt.Errorf("serversets: candidate node %s was deleted out from under the campaign", e.nodePath))
+				e.conn.Close()
+				return
+			}
+
+		case evt, ok := <-e.events:
+			if !ok {
+				return
+			}
+			if evt.State == zk.StateExpired {
+				e.mu.Lock()
+				e.expired = true
+				e.mu.Unlock()
+				e.setErr(zk.ErrSessionExpired)
+				e.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (e *Election) setErr(err error) {
+	e.mu.Lock()
+	e.err = err
+	e.mu.Unlock()
+}
+
+// Err returns the reason leadership was lost, if the leadership channel
+// returned by Campaign closed for any reason other than Resign.
+func (e *Election) Err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
+
+// Resign voluntarily gives up leadership by deleting this candidate's
+// znode, closing the channel returned by Campaign. It's a no-op if
+// Campaign hasn't been called or has already ended.
+func (e *Election) Resign() error {
+	e.mu.Lock()
+	conn := e.conn
+	nodePath := e.nodePath
+	resigned := e.resigned
+	resignOnce := e.resignOnce
+	e.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+
+	resignErr := error(nil)
+	resignOnce.Do(func() {
+		close(resigned)
+		if err := conn.Delete(nodePath, -1); err != nil && err != zk.ErrNoNode && err != zk.ErrClosing {
+			resignErr = err
+		}
+		conn.Close()
+	})
+
+	return resignErr
+}
+
+// Leader returns the Entity of the current leader, i.e. whichever
+// candidate holds the lowest sequence number. It can be called by any
+// process that knows about the Election, not just competitors: an
+// Election that hasn't campaigned reads the leader over a short-lived
+// connection of its own.
+func (e *Election) Leader() (Entity, error) {
+	e.mu.Lock()
+	conn := e.conn
+	e.mu.Unlock()
+
+	if conn == nil {
+		observer, _, err := e.ss.connectToZookeeper()
+		if err != nil {
+			var zero Entity
+			return zero, err
+		}
+		defer observer.Close()
+		conn = observer
+	}
+
+	children, _, err := conn.Children(e.dir)
+	if err != nil {
+		var zero Entity
+		return zero, err
+	}
+	if len(children) == 0 {
+		var zero Entity
+		return zero, fmt.Errorf("serversets: no candidates in election")
+	}
+	sort.Strings(children)
+
+	data, _, err := conn.Get(path.Join(e.dir, children[0]))
+	if err != nil {
+		var zero Entity
+		return zero, err
+	}
+
+	var leader Entity
+	if err := json.Unmarshal(data, &leader); err != nil {
+		return leader, err
+	}
+
+	return leader, nil
+}
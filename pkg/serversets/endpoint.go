@@ -0,0 +1,386 @@
+package serversets
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/go-zookeeper/zk"
+)
+
+// DefaultMaxReregisterAttempts is the number of consecutive failed
+// re-registration attempts an Endpoint tolerates before giving up and
+// closing its Done channel.
+var DefaultMaxReregisterAttempts = 5
+
+// maxUpdateAttempts bounds how many compare-and-set attempts Update
+// makes in all, the first one included, before giving up on a znode
+// whose version keeps changing under it.
+const maxUpdateAttempts = 5
+
+// EndpointOption customizes the Entity or registration behavior of an
+// Endpoint created by RegisterEndpoint.
+type EndpointOption func(*endpointConfig) error
+
+type endpointConfig struct {
+	entity                *Entity
+	maxReregisterAttempts int
+}
+
+// WithMaxReregisterAttempts overrides how many consecutive failed
+// re-registration attempts an Endpoint tolerates before giving up. The
+// default is DefaultMaxReregisterAttempts.
+func WithMaxReregisterAttempts(n int) EndpointOption {
+	return func(cfg *endpointConfig) error {
+		cfg.maxReregisterAttempts = n
+		return nil
+	}
+}
+
+// WithShard sets the Entity's shard id, letting readers make
+// load-balancing decisions based on it.
+func WithShard(shard int64) EndpointOption {
+	return func(cfg *endpointConfig) error {
+		cfg.entity.Shard = shard
+		return nil
+	}
+}
+
+// WithAdditionalEndpoint publishes an extra named endpoint (e.g.
+// "http", "admin") alongside the primary service endpoint.
+func WithAdditionalEndpoint(name, host string, port int) EndpointOption {
+	return func(cfg *endpointConfig) error {
+		cfg.entity.AdditionalEndpoints[name] = endpoint{host, port}
+		return nil
+	}
+}
+
+// WithStatus sets the Entity's initial status. status must be one of
+// the Status* constants; any other value is a registration error.
+func WithStatus(status string) EndpointOption {
+	return func(cfg *endpointConfig) error {
+		if !validStatus(status) {
+			return fmt.Errorf("serversets: invalid status %q", status)
+		}
+		cfg.entity.Status = status
+		return nil
+	}
+}
+
+// Endpoint is a long-lived registration of a single service instance in
+// a ServerSet. Unlike a one-shot registration, an Endpoint keeps its own
+// *zk.Conn for its entire lifetime and watches for ZooKeeper session
+// expiration or deletion of its member znode, re-creating the
+// registration automatically so the service doesn't silently disappear
+// from discovery after a network blip or ZooKeeper failover.
+type Endpoint struct {
+	ss     *ServerSet
+	conn   *zk.Conn
+	events <-chan zk.Event
+
+	entity                *Entity
+	maxReregisterAttempts int
+
+	mu       sync.Mutex
+	nodePath string
+	version  int32
+
+	closed chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+// RegisterEndpoint connects to ZooKeeper and creates a sequential
+// ephemeral member znode advertising host:port, keeping it registered
+// for the lifetime of the returned Endpoint. Call Close when the
+// endpoint should be removed from discovery.
+func (ss *ServerSet) RegisterEndpoint(host string, port int, opts ...EndpointOption) (*Endpoint, error) {
+	cfg := &endpointConfig{
+		entity:                newEntity(host, port),
+		maxReregisterAttempts: DefaultMaxReregisterAttempts,
+	}
+	for _, opt := range opts {
+		if err := opt(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, events, err := ss.connectToZookeeper()
+	if err != nil {
+		return nil, err
+	}
+
+	ep := &Endpoint{
+		ss:                    ss,
+		conn:                  conn,
+		events:                events,
+		entity:                cfg.entity,
+		maxReregisterAttempts: cfg.maxReregisterAttempts,
+		closed:                make(chan struct{}),
+		done:                  make(chan struct{}),
+	}
+
+	if err := ep.register(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go ep.watch()
+
+	return ep, nil
+}
+
+// Done returns a channel that is closed when the endpoint's background
+// re-registration goroutine stops, whether because Close was called or
+// because re-registration failed maxReregisterAttempts times in a row.
+// Callers can select on Done to notice permanent registration loss and
+// call RegisterEndpoint again.
+func (ep *Endpoint) Done() <-chan struct{} {
+	return ep.done
+}
+
+// Close deletes the endpoint's znode and stops the background
+// re-registration goroutine. It is safe to call Close more than once.
+func (ep *Endpoint) Close() error {
+	var err error
+
+	ep.once.Do(func() {
+		close(ep.closed)
+
+		ep.mu.Lock()
+		p := ep.nodePath
+		ep.mu.Unlock()
+
+		if p != "" {
+			if delErr := ep.conn.Delete(p, -1); delErr != nil && delErr != zk.ErrNoNode {
+				err = delErr
+			}
+		}
+
+		ep.conn.Close()
+	})
+
+	<-ep.done
+
+	return err
+}
+
+// UpdateStatus validates newStatus and rewrites the endpoint's member
+// znode data in place, rather than deleting and re-creating the node.
+// This gives operators a proper graceful-shutdown path (StatusStopping
+// -> drain -> Close) without a window where the service disappears
+// from discovery.
+func (ep *Endpoint) UpdateStatus(newStatus string) error {
+	if !validStatus(newStatus) {
+		return fmt.Errorf("serversets: invalid status %q", newStatus)
+	}
+
+	return ep.Update(func(entity *Entity) (*Entity, error) {
+		entity.Status = newStatus
+		return entity, nil
+	})
+}
+
+// Update applies mutate to the endpoint's Entity and writes the result
+// back with a compare-and-set against the znode's last-known version,
+// so a concurrent writer (e.g. a health checker racing the app itself)
+// can't silently lose the other's update. On a version conflict it
+// re-reads the current znode and retries mutate against the fresh
+// state; mutate runs at most maxUpdateAttempts times in all. zk.ErrNoNode is returned
+// unchanged so callers can tell their registration was lost (session
+// expired, node deleted) and re-register rather than overwrite
+// whoever's ephemeral now occupies that path.
+func (ep *Endpoint) Update(mutate func(*Entity) (*Entity, error)) error {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		ep.mu.Lock()
+		nodePath := ep.nodePath
+		version := ep.version
+		current := ep.entity.clone()
+		ep.mu.Unlock()
+
+		next, err := mutate(current)
+		if err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(next)
+		if err != nil {
+			return err
+		}
+
+		stat, err := ep.conn.Set(nodePath, data, version)
+		switch err {
+		case nil:
+			ep.mu.Lock()
+			ep.entity = next
+			ep.version = stat.Version
+			ep.mu.Unlock()
+			return nil
+
+		case zk.ErrBadVersion:
+			if refreshErr := ep.refresh(); refreshErr != nil {
+				return refreshErr
+			}
+			continue
+
+		default:
+			return err
+		}
+	}
+
+	return fmt.Errorf("serversets: update did not converge after %d attempts", maxUpdateAttempts)
+}
+
+// refresh re-reads the endpoint's current Entity and version from
+// ZooKeeper, for Update to retry its mutation against after losing a
+// compare-and-set race.
+func (ep *Endpoint) refresh() error {
+	ep.mu.Lock()
+	nodePath := ep.nodePath
+	ep.mu.Unlock()
+
+	data, stat, err := ep.conn.Get(nodePath)
+	if err != nil {
+		return err
+	}
+
+	var entity Entity
+	if err := json.Unmarshal(data, &entity); err != nil {
+		return err
+	}
+
+	ep.mu.Lock()
+	ep.entity = &entity
+	ep.version = stat.Version
+	ep.mu.Unlock()
+
+	return nil
+}
+
+// register creates the parent directories and a fresh sequential
+// ephemeral member znode for the endpoint's current Entity.
+func (ep *Endpoint) register() error {
+	if err := ep.ss.createFullPath(ep.conn); err != nil {
+		return err
+	}
+
+	ep.mu.Lock()
+	data, err := json.Marshal(ep.entity)
+	ep.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	nodePath, err := ep.conn.Create(
+		ep.ss.directoryPath()+"/"+MemberPrefix,
+		data,
+		zk.FlagEphemeral|zk.FlagSequence,
+		ep.ss.memberACL(),
+	)
+	if err != nil {
+		return err
+	}
+
+	ep.mu.Lock()
+	ep.nodePath = nodePath
+	ep.version = 0
+	ep.mu.Unlock()
+
+	return nil
+}
+
+// reregisterIfMissing re-creates the member znode only if it's no
+// longer present, avoiding a duplicate registration when the session
+// event fires but the node actually survived.
+func (ep *Endpoint) reregisterIfMissing() error {
+	ep.mu.Lock()
+	p := ep.nodePath
+	ep.mu.Unlock()
+
+	if p != "" {
+		if exists, _, err := ep.conn.Exists(p); err == nil && exists {
+			return nil
+		}
+	}
+
+	return ep.register()
+}
+
+// nodeWatch sets a watch on the endpoint's current znode, returning the
+// channel that fires once the node changes or is deleted. It returns
+// nil if the endpoint isn't registered yet or the watch can't be set,
+// in which case the next session event drives re-registration instead.
+func (ep *Endpoint) nodeWatch() <-chan zk.Event {
+	ep.mu.Lock()
+	p := ep.nodePath
+	ep.mu.Unlock()
+
+	if p == "" {
+		return nil
+	}
+
+	_, _, ch, err := ep.conn.GetW(p)
+	if err != nil {
+		return nil
+	}
+
+	return ch
+}
+
+// watch is the pid-node maintenance loop: it re-creates the member
+// znode whenever the ZooKeeper session is (re-)established or the node
+// is observed deleted while the session is still alive. It runs until
+// Close is called or re-registration fails maxReregisterAttempts times
+// in a row.
+func (ep *Endpoint) watch() {
+	defer close(ep.done)
+
+	nodeEvents := ep.nodeWatch()
+	failures := 0
+
+	for {
+		select {
+		case <-ep.closed:
+			return
+
+		case evt, ok := <-ep.events:
+			if !ok {
+				return
+			}
+
+			if evt.State != zk.StateHasSession {
+				continue
+			}
+
+			if err := ep.reregisterIfMissing(); err != nil {
+				failures++
+				if failures >= ep.maxReregisterAttempts {
+					return
+				}
+				continue
+			}
+
+			failures = 0
+			nodeEvents = ep.nodeWatch()
+
+		case evt, ok := <-nodeEvents:
+			if !ok {
+				nodeEvents = nil
+				continue
+			}
+
+			if evt.Type == zk.EventNodeDeleted {
+				if err := ep.register(); err != nil {
+					failures++
+					if failures >= ep.maxReregisterAttempts {
+						return
+					}
+					continue
+				}
+				failures = 0
+			}
+
+			nodeEvents = ep.nodeWatch()
+		}
+	}
+}
@@ -32,7 +32,14 @@ var DefaultZKTimeout = 5 * time.Second
 // A ServerSet represents a service with a set of servers that may change over time.
 // The master lists of servers is kept as ephemeral nodes in Zookeeper.
 type ServerSet struct {
-	ZKTimeout   time.Duration
+	ZKTimeout time.Duration
+
+	// AuthProvider supplies the ACL used on created znodes and, if
+	// needed, authenticates the connection. Defaults to a provider
+	// equivalent to the historical zk.WorldACL(zk.PermAll) behavior;
+	// set it before registering or watching to use a secured cluster.
+	AuthProvider AuthProvider
+
 	role        string
 	environment string
 	service     string
@@ -48,11 +55,12 @@ func New(role string, environment string, service string, zookeepers []string) *
 	}
 
 	ss := &ServerSet{
-		ZKTimeout:   DefaultZKTimeout,
-		role:        role,
-		environment: environment,
-		service:     service,
-		zkServers:   zookeepers,
+		ZKTimeout:    DefaultZKTimeout,
+		AuthProvider: worldACLAuth{},
+		role:         role,
+		environment:  environment,
+		service:      service,
+		zkServers:    zookeepers,
 	}
 
 	return ss
@@ -65,7 +73,32 @@ func (ss *ServerSet) ZookeeperServers() []string {
 }
 
 func (ss *ServerSet) connectToZookeeper() (*zk.Conn, <-chan zk.Event, error) {
-	return zk.Connect(ss.zkServers, ss.ZKTimeout)
+	conn, events, err := zk.Connect(ss.zkServers, ss.ZKTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := ss.AuthProvider.AddAuth(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	return conn, events, nil
+}
+
+// memberACL returns the ACL applied to member znodes.
+func (ss *ServerSet) memberACL() []zk.ACL {
+	return ss.AuthProvider.ACL()
+}
+
+// directoryACL returns the ACL applied to parent directory znodes,
+// which may be more permissive than memberACL when AuthProvider
+// implements DirectoryACLProvider.
+func (ss *ServerSet) directoryACL() []zk.ACL {
+	if p, ok := ss.AuthProvider.(DirectoryACLProvider); ok {
+		return p.DirectoryACL()
+	}
+	return ss.AuthProvider.ACL()
 }
 
 // directoryPath returns the base path of where all the ephemeral nodes will live.
@@ -96,11 +129,62 @@ func splitPaths(fullPath string) []string {
 
 // createFullPath makes sure all the znodes are created for the parent directories
 func (ss *ServerSet) createFullPath(connection *zk.Conn) error {
-	paths := splitPaths(ss.directoryPath())
+	return ss.createPath(connection, ss.directoryPath())
+}
+
+// createPath makes sure all the znodes are created for fullPath and
+// every parent directory above it, using ss's directoryACL. It's shared by
+// createFullPath and any other namespace (e.g. Election) rooted under
+// this ServerSet.
+//
+// It first tries to create every level in a single Multi transaction
+// (the "mkdir -p" the old TODO here asked for), which is one
+// round-trip instead of one per level on a cold cluster. A ZooKeeper
+// multi-transaction is all-or-nothing: if any level already exists
+// (the normal case once BaseDirectory/role/env have been created once)
+// the whole batch is rolled back and Multi reports that level's error
+// -- e.g. zk.ErrNodeExists -- as the overall error, not a distinct
+// "partially applied" signal. So any error from the Multi attempt,
+// not just ErrAPIError from servers too old to support it, means none
+// of the batch's creates took effect and we fall back to the original
+// one-Create-per-level loop, which tolerates individual levels already
+// existing.
+func (ss *ServerSet) createPath(connection *zk.Conn, fullPath string) error {
+	paths := splitPaths(fullPath)
+	acl := ss.directoryACL()
+
+	if err := ss.createPathMulti(connection, paths, acl); err != nil {
+		return ss.createPathSequential(connection, paths, acl)
+	}
 
-	// TODO: can't we just create all? ie. mkdir -p
+	return nil
+}
+
+// createPathMulti creates every level of paths in a single Multi
+// transaction. It reports whatever error Multi returns; since the
+// transaction is atomic, a non-nil error here means none of the levels
+// were created, regardless of which op it names.
+func (ss *ServerSet) createPathMulti(connection *zk.Conn, paths []string, acl []zk.ACL) error {
+	ops := make([]interface{}, len(paths))
+	for i, key := range paths {
+		ops[i] = &zk.CreateRequest{
+			Path: key,
+			Data: nil,
+			Acl:  acl,
+		}
+	}
+
+	_, err := connection.Multi(ops...)
+	return err
+}
+
+// createPathSequential is the original "one Create per level" fallback,
+// used by createPath whenever the Multi attempt fails: most often
+// because some level already exists, or because the server doesn't
+// support Multi.
+func (ss *ServerSet) createPathSequential(connection *zk.Conn, paths []string, acl []zk.ACL) error {
 	for _, key := range paths {
-		_, err := connection.Create(key, nil, 0, zk.WorldACL(zk.PermAll))
+		_, err := connection.Create(key, nil, 0, acl)
 		if err != nil && err != zk.ErrNodeExists {
 			return err
 		}
@@ -136,22 +220,48 @@ type endpoint struct {
 	Port int    `json:"port"`
 }
 
+// clone returns a deep copy of e. AdditionalEndpoints is a map, so a
+// plain dereference would leave the copy aliasing the original's
+// backing map; callers that hand the copy to code running outside the
+// Entity's owning lock (e.g. Endpoint.Update's mutate callback) need a
+// copy that's safe to read and write independently.
+func (e *Entity) clone() *Entity {
+	clone := *e
+
+	clone.AdditionalEndpoints = make(map[string]endpoint, len(e.AdditionalEndpoints))
+	for name, ep := range e.AdditionalEndpoints {
+		clone.AdditionalEndpoints[name] = ep
+	}
+
+	return &clone
+}
+
 func newEntity(host string, port int) *Entity {
 	return &Entity{
 		ServiceEndpoint:     endpoint{host, port},
 		AdditionalEndpoints: make(map[string]endpoint),
 		Shard:               0,
-		Status:              statusAlive,
+		Status:              StatusAlive,
 	}
 }
 
-// possible endpoint statuses. Currently only concerned with ALIVE.
+// possible endpoint statuses, matching Finagle's ServerSet status enum.
 const (
-	statusDead     = "DEAD"
-	statusStarting = "STARTING"
-	statusAlive    = "ALIVE"
-	statusStopping = "STOPPING"
-	statusStopped  = "STOPPED"
-	statusWarning  = "WARNING"
-	statusUnknown  = "UNKNOWN"
+	StatusDead     = "DEAD"
+	StatusStarting = "STARTING"
+	StatusAlive    = "ALIVE"
+	StatusStopping = "STOPPING"
+	StatusStopped  = "STOPPED"
+	StatusWarning  = "WARNING"
+	StatusUnknown  = "UNKNOWN"
 )
+
+// validStatus reports whether status is one of the Status* constants.
+func validStatus(status string) bool {
+	switch status {
+	case StatusDead, StatusStarting, StatusAlive, StatusStopping, StatusStopped, StatusWarning, StatusUnknown:
+		return true
+	default:
+		return false
+	}
+}